@@ -0,0 +1,286 @@
+package viamupnp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/koron/go-ssdp"
+	"go.viam.com/rdk/logging"
+)
+
+// FindOptions tunes how findAll searches for and describes devices. The zero value picks
+// sane defaults, see withDefaults.
+type FindOptions struct {
+	// Interfaces restricts which network interfaces are searched. If empty, all
+	// multicast-capable interfaces on the host are searched.
+	Interfaces []net.Interface
+
+	// Attempts is how many retry rounds of SSDP search to perform per interface.
+	Attempts int
+
+	// MX is the SSDP search "MX" (max wait, in seconds) used on each attempt.
+	MX int
+
+	// DescribeConcurrency bounds how many device descriptions are fetched in parallel.
+	DescribeConcurrency int
+
+	// PerRequestTimeout bounds how long a single device-description fetch may take.
+	PerRequestTimeout time.Duration
+
+	// Backends lists the discovery backends to search, merging their results. If empty,
+	// SSDP (SSDPDiscoverer) is used alone.
+	Backends []Discoverer
+}
+
+func (o FindOptions) withDefaults() FindOptions {
+	if o.Attempts <= 0 {
+		o.Attempts = 3
+	}
+	if o.MX <= 0 {
+		o.MX = 1
+	}
+	if o.DescribeConcurrency <= 0 {
+		o.DescribeConcurrency = 8
+	}
+	if o.PerRequestTimeout <= 0 {
+		o.PerRequestTimeout = 10 * time.Second //nolint:mnd
+	}
+	return o
+}
+
+// multicastInterfaces lists the host's multicast-capable, up interfaces, mirroring the
+// filtering go-ssdp itself does when no Interfaces override is set.
+func multicastInterfaces() ([]net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]net.Interface, 0, len(ifaces))
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		out = append(out, ifi)
+	}
+	return out, nil
+}
+
+// serviceKey is how discovered services are deduplicated: by USN (which encodes the
+// device's UDN), falling back to location for the rare service that omits one.
+func serviceKey(s ssdp.Service) string {
+	if s.USN != "" {
+		return s.USN
+	}
+	return s.Location
+}
+
+// ssdpInterfaceMu serializes access to ssdp.Interfaces: go-ssdp exposes the set of
+// interfaces to multicast on as a package-level global rather than a per-call option, so
+// searchInterface calls must take turns setting it rather than racing each other.
+var ssdpInterfaceMu sync.Mutex
+
+// searchOnce runs a single SSDP search restricted to ifi. It only holds ssdpInterfaceMu for
+// the duration of the search itself, not for any caller-side retry/backoff, so that other
+// interfaces' searches can interleave with this one's backoff waits instead of queuing
+// behind them.
+func searchOnce(ifi net.Interface, network, searchType string, opts FindOptions) ([]ssdp.Service, error) {
+	ssdpInterfaceMu.Lock()
+	defer ssdpInterfaceMu.Unlock()
+
+	prev := ssdp.Interfaces
+	ssdp.Interfaces = []net.Interface{ifi}
+	defer func() { ssdp.Interfaces = prev }()
+
+	return ssdp.Search(searchType, opts.MX, network)
+}
+
+// searchInterface runs opts.Attempts rounds of SSDP search restricted to ifi, with
+// exponential backoff between rounds, and returns the union of services found.
+func searchInterface(
+	ctx context.Context, logger logging.Logger, ifi net.Interface, network, searchType string, opts FindOptions,
+) ([]ssdp.Service, error) {
+	found := map[string]ssdp.Service{}
+	backoff := time.Second
+	for attempt := 0; attempt < opts.Attempts; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		list, err := searchOnce(ifi, network, searchType, opts)
+		if err != nil {
+			logger.Warnf("ssdp search on %s (attempt %d) failed: %v", ifi.Name, attempt, err)
+		}
+		for _, s := range list {
+			found[serviceKey(s)] = s
+		}
+
+		if attempt < opts.Attempts-1 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+
+	out := make([]ssdp.Service, 0, len(found))
+	for _, s := range found {
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Discoverer finds devices reachable on network, regardless of which wire protocol it uses
+// to do so (SSDP, mDNS/DNS-SD, ...). discoverNetwork fans out to the backends configured in
+// FindOptions.Backends (SSDP only by default) and merges their results.
+type Discoverer interface {
+	Discover(ctx context.Context, network string) ([]UPNPDevice, error)
+}
+
+// SSDPDiscoverer finds devices via UPnP's native SSDP M-SEARCH discovery. It's the default,
+// and only, backend used unless FindOptions.Backends is set.
+type SSDPDiscoverer struct {
+	Logger   logging.Logger
+	RootOnly bool
+	Options  FindOptions
+}
+
+// Discover implements Discoverer.
+func (d *SSDPDiscoverer) Discover(ctx context.Context, network string) ([]UPNPDevice, error) {
+	return findAll(ctx, d.Logger, network, d.RootOnly, d.Options)
+}
+
+// discoverNetwork merges the results of every configured backend for network, deduping
+// devices found by more than one backend by USN.
+func discoverNetwork(ctx context.Context, logger logging.Logger, network string, rootOnly bool, opts FindOptions) ([]UPNPDevice, error) {
+	if all, ok := ctx.Value(FindAllTestKey).([]UPNPDevice); ok {
+		return all, nil
+	}
+
+	backends := opts.Backends
+	if len(backends) == 0 {
+		backends = []Discoverer{&SSDPDiscoverer{Logger: logger, RootOnly: rootOnly, Options: opts}}
+	}
+
+	seen := map[string]struct{}{}
+	all := []UPNPDevice{}
+	for _, backend := range backends {
+		devices, err := backend.Discover(ctx, network)
+		if err != nil {
+			logger.Warnf("discovery backend failed: %v", err)
+			continue
+		}
+
+		for _, d := range devices {
+			key := serviceKey(d.Service)
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			all = append(all, d)
+		}
+	}
+
+	return all, nil
+}
+
+func findAll(ctx context.Context, logger logging.Logger, network string, rootOnly bool, opts FindOptions) ([]UPNPDevice, error) {
+	opts = opts.withDefaults()
+
+	// All returns all services, which can be useful for debugging or looking for specific endpoints.
+	searchType := ssdp.All
+	if rootOnly {
+		// RootDevice only returns the root, which significantly reduces the amount of services to test.
+		searchType = ssdp.RootDevice
+	}
+
+	ifaces := opts.Interfaces
+	if len(ifaces) == 0 {
+		var err error
+		ifaces, err = multicastInterfaces()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	services := map[string]ssdp.Service{}
+	var servicesMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ifi := range ifaces {
+		wg.Add(1)
+		go func(ifi net.Interface) {
+			defer wg.Done()
+
+			list, err := searchInterface(ctx, logger, ifi, network, searchType, opts)
+			if err != nil {
+				logger.Warnf("search on %s failed: %v", ifi.Name, err)
+				return
+			}
+
+			servicesMu.Lock()
+			for _, s := range list {
+				services[serviceKey(s)] = s
+			}
+			servicesMu.Unlock()
+		}(ifi)
+	}
+	wg.Wait()
+
+	return describeAll(ctx, logger, services, opts), nil
+}
+
+// describeAll fetches the device description for each service with a bounded worker pool,
+// so the same device reached via multiple interfaces (already deduped by USN in services)
+// is only ever queried once.
+func describeAll(ctx context.Context, logger logging.Logger, services map[string]ssdp.Service, opts FindOptions) []UPNPDevice {
+	jobs := make(chan ssdp.Service)
+	go func() {
+		for _, s := range services {
+			jobs <- s
+		}
+		close(jobs)
+	}()
+
+	concurrency := opts.DescribeConcurrency
+	if concurrency > len(services) {
+		concurrency = len(services)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make(chan UPNPDevice, len(services))
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for srv := range jobs {
+				logger.Debugf("found service (%s) at %s", srv.Type, srv.Location)
+
+				descCtx, cancel := context.WithTimeout(ctx, opts.PerRequestTimeout)
+				desc, err := readDeviceDesc(descCtx, srv.Location)
+				cancel()
+				if err != nil {
+					logger.Warnf("cannot read description %v", err)
+					continue
+				}
+
+				logger.Debugf("got description %v", desc)
+				results <- UPNPDevice{srv, desc}
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	all := make([]UPNPDevice, 0, len(services))
+	for d := range results {
+		all = append(all, d)
+	}
+	return all
+}
@@ -0,0 +1,62 @@
+package viamupnp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koron/go-ssdp"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+func TestDescribeAllRespectsConcurrencyBound(t *testing.T) {
+	const (
+		numServices = 6
+		concurrency = 3
+	)
+
+	var inFlight, peak int64
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inFlight, 1)
+		mu.Lock()
+		if n > peak {
+			peak = n
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond) //nolint:mnd
+
+		atomic.AddInt64(&inFlight, -1)
+		w.Write([]byte(testDeviceDescXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	services := map[string]ssdp.Service{}
+	for i := 0; i < numServices; i++ {
+		usn := "uuid:" + string(rune('a'+i))
+		services[usn] = ssdp.Service{USN: usn, Location: srv.URL}
+	}
+
+	opts := FindOptions{DescribeConcurrency: concurrency}.withDefaults()
+	devices := describeAll(context.Background(), logging.NewTestLogger(t), services, opts)
+
+	test.That(t, len(devices), test.ShouldEqual, numServices)
+	test.That(t, peak > 1, test.ShouldBeTrue)
+	test.That(t, peak <= concurrency, test.ShouldBeTrue)
+}
+
+func TestSearchInterfaceReturnsImmediatelyOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := FindOptions{Attempts: 3, MX: 1}.withDefaults()
+	_, err := searchInterface(ctx, logging.NewTestLogger(t), net.Interface{}, "", ssdp.All, opts)
+	test.That(t, err, test.ShouldEqual, context.Canceled)
+}
@@ -2,26 +2,48 @@
 package viamupnp
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/koron/go-ssdp"
 	"go.viam.com/rdk/logging"
+	"golang.org/x/net/html/charset"
 )
 
-// DeviceQuery specifics a query for a network device.
+// DeviceQuery specifics a query for a network device. Every non-empty field other than
+// Network (exact or regex) must match for a device to satisfy the query; Network only picks
+// which network is searched. Exact-match fields support a single
+// trailing ".*" wildcard; the {Field}Regex variants compile as a regular expression instead,
+// for when a prefix wildcard isn't precise enough (e.g. matching on UDN or deviceType).
 type DeviceQuery struct {
-	ModelName    string `json:"model_name"`
-	Manufacturer string `json:"manufacturer"`
-	SerialNumber string `json:"serial_number"`
-	Network      string `json:"network"`
+	ModelName        string `json:"model_name"`
+	ModelNumber      string `json:"model_number"`
+	ModelDescription string `json:"model_description"`
+	Manufacturer     string `json:"manufacturer"`
+	SerialNumber     string `json:"serial_number"`
+	UDN              string `json:"udn"`
+	DeviceType       string `json:"device_type"`
+	FriendlyName     string `json:"friendly_name"`
+	Network          string `json:"network"`
+
+	ModelNameRegex        string `json:"model_name_regex"`
+	ModelNumberRegex      string `json:"model_number_regex"`
+	ModelDescriptionRegex string `json:"model_description_regex"`
+	ManufacturerRegex     string `json:"manufacturer_regex"`
+	SerialNumberRegex     string `json:"serial_number_regex"`
+	UDNRegex              string `json:"udn_regex"`
+	DeviceTypeRegex       string `json:"device_type_regex"`
+	FriendlyNameRegex     string `json:"friendly_name_regex"`
 }
 
 // UPNPDevice is a UPNPDevice device.
@@ -30,6 +52,15 @@ type UPNPDevice struct {
 	Desc    *deviceDesc
 }
 
+// FoundDevice is a device FindHost matched, along with the query it matched and the UPnP
+// identifiers that distinguish it from other devices a loose query might also match.
+type FoundDevice struct {
+	Query        DeviceQuery
+	UDN          string
+	DeviceType   string
+	FriendlyName string
+}
+
 func parseNetworks(queries []DeviceQuery) []string {
 	networks := []string{}
 	for _, query := range queries {
@@ -40,17 +71,49 @@ func parseNetworks(queries []DeviceQuery) []string {
 	return networks
 }
 
-// FindHost looks for hosts that match the queries, returns the host/ip (no port) and a map of hosts to queries.
-// All supplied fields of a query must match a discovered device, and the host will map to the first matching query.
-// Using the map allows users to know which devices were found.
+// FindHost looks for hosts that match the queries, returns the host/ip (no port) and a map of
+// hosts to queries. All supplied fields of a query must match a discovered device, and the
+// host will map to the first matching query. Using the map allows users to know which
+// devices were found.
 func FindHost(ctx context.Context, logger logging.Logger, queries []DeviceQuery, rootOnly bool) ([]string, map[string]DeviceQuery, error) {
+	return FindHostWithOptions(ctx, logger, queries, rootOnly, FindOptions{})
+}
+
+// FindHostWithOptions is like FindHost, but lets callers tune the underlying SSDP search:
+// which interfaces to search, how many retry rounds to do, and how much description-fetching
+// to parallelize. See FindOptions for defaults.
+func FindHostWithOptions(
+	ctx context.Context, logger logging.Logger, queries []DeviceQuery, rootOnly bool, opts FindOptions,
+) ([]string, map[string]DeviceQuery, error) {
+	hostnames, found, err := FindHostWithOptionsDetailed(ctx, logger, queries, rootOnly, opts)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	foundQueries := make(map[string]DeviceQuery, len(found))
+	for host, d := range found {
+		foundQueries[host] = d.Query
+	}
+	return hostnames, foundQueries, nil
+}
+
+// FindHostDetailed is like FindHost, but the returned map also carries the UDN, deviceType,
+// and friendlyName of the device that matched each host, for callers that need to
+// distinguish between multiple devices a loose query might equally match.
+func FindHostDetailed(ctx context.Context, logger logging.Logger, queries []DeviceQuery, rootOnly bool) ([]string, map[string]FoundDevice, error) {
+	return FindHostWithOptionsDetailed(ctx, logger, queries, rootOnly, FindOptions{})
+}
+
+// FindHostWithOptionsDetailed combines FindHostWithOptions and FindHostDetailed.
+func FindHostWithOptionsDetailed(
+	ctx context.Context, logger logging.Logger, queries []DeviceQuery, rootOnly bool, opts FindOptions,
+) ([]string, map[string]FoundDevice, error) {
 	networks := parseNetworks(queries)
 	hostnames := []string{}
-	foundQueries := map[string]DeviceQuery{}
+	found := map[string]FoundDevice{}
 	for _, network := range networks {
 
-		all, err := findAll(ctx, logger, network, rootOnly)
+		all, err := discoverNetwork(ctx, logger, network, rootOnly, opts)
 		if err != nil {
 			return []string{}, nil, err
 		}
@@ -69,7 +132,12 @@ func FindHost(ctx context.Context, logger logging.Logger, queries []DeviceQuery,
 					// don't repeat hostnames we already found.
 					if !slices.Contains(hostnames, u.Hostname()) {
 						hostnames = append(hostnames, u.Hostname())
-						foundQueries[u.Hostname()] = query
+						found[u.Hostname()] = FoundDevice{
+							Query:        query,
+							UDN:          a.Desc.Device.UDN,
+							DeviceType:   a.Desc.Device.DeviceType,
+							FriendlyName: a.Desc.Device.FriendlyName,
+						}
 					}
 
 				}
@@ -77,7 +145,7 @@ func FindHost(ctx context.Context, logger logging.Logger, queries []DeviceQuery,
 		}
 	}
 	if len(hostnames) > 0 {
-		return hostnames, foundQueries, nil
+		return hostnames, found, nil
 	}
 
 	return []string{}, nil, fmt.Errorf("no match found for queries: %v", queries)
@@ -96,63 +164,95 @@ func matches(query string, s string) bool {
 	return false
 }
 
+// matchField reports whether value satisfies an exact-match (with trailing ".*" wildcard)
+// and/or regex field of a query. An empty exact/regex means that field isn't filtered on.
+func matchField(exact, regexPattern, value string) bool {
+	if exact != "" && !matches(exact, value) {
+		return false
+	}
+
+	if regexPattern != "" {
+		re, err := compileRegex(regexPattern)
+		if err != nil {
+			return false
+		}
+		if !re.MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Matches returns if the UPNPDevice matches the query.
 func (pc *UPNPDevice) Matches(query DeviceQuery) bool {
-	if query.ModelName != "" && !matches(query.ModelName, pc.Desc.Device.ModelName) {
+	d := pc.Desc.Device
+
+	if !matchField(query.ModelName, query.ModelNameRegex, d.ModelName) {
 		return false
 	}
 
-	if query.Manufacturer != "" && !matches(query.Manufacturer, pc.Desc.Device.Manufacturer) {
+	if !matchField(query.ModelNumber, query.ModelNumberRegex, d.ModelNumber) {
 		return false
 	}
 
-	if query.SerialNumber != "" && !matches(query.SerialNumber, pc.Desc.Device.SerialNumber) {
+	if !matchField(query.ModelDescription, query.ModelDescriptionRegex, d.ModelDescription) {
 		return false
 	}
 
-	return true
-}
+	if !matchField(query.Manufacturer, query.ManufacturerRegex, d.Manufacturer) {
+		return false
+	}
 
-// FindAllTestKeyStruct - for testing.
-type FindAllTestKeyStruct string
+	if !matchField(query.SerialNumber, query.SerialNumberRegex, d.SerialNumber) {
+		return false
+	}
 
-// FindAllTestKey - for testing.
-const FindAllTestKey = FindAllTestKeyStruct("findAllTestKey1231231231231")
+	if !matchField(query.UDN, query.UDNRegex, d.UDN) {
+		return false
+	}
 
-func findAll(ctx context.Context, logger logging.Logger, network string, rootOnly bool) ([]UPNPDevice, error) {
-	all, ok := ctx.Value(FindAllTestKey).([]UPNPDevice)
-	if ok {
-		return all, nil
+	if !matchField(query.DeviceType, query.DeviceTypeRegex, d.DeviceType) {
+		return false
 	}
 
-	// All returns all services, which can be useful for debugging or looking for specific endpoints.
-	searchType := ssdp.All
-	if rootOnly {
-		// RootDevice only returns the root, which significantly reduces the amount of services to test.
-		searchType = ssdp.RootDevice
+	if !matchField(query.FriendlyName, query.FriendlyNameRegex, d.FriendlyName) {
+		return false
 	}
 
-	all = []UPNPDevice{}
-	list, err := ssdp.Search(searchType, 1, network) //nolint:mnd
+	return true
+}
+
+// regexCache memoizes compiled query regexes, since the same DeviceQuery is matched against
+// every discovered device.
+var regexCache sync.Map
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if v, ok := regexCache.Load(pattern); ok {
+		return v.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, srv := range list {
-		logger.Debugf("found service (%s) at %s", srv.Type, srv.Location)
-
-		desc, err := readDeviceDesc(ctx, srv.Location)
-		if err != nil {
-			logger.Warnf("cannot read description %v", err)
-			continue
-		}
+	actual, _ := regexCache.LoadOrStore(pattern, re)
+	return actual.(*regexp.Regexp), nil
+}
 
-		logger.Debugf("got description %v", desc)
+// FindAllTestKeyStruct - for testing.
+type FindAllTestKeyStruct string
 
-		all = append(all, UPNPDevice{srv, desc})
-	}
+// FindAllTestKey - for testing.
+const FindAllTestKey = FindAllTestKeyStruct("findAllTestKey1231231231231")
 
-	return all, nil
+type serviceDesc struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
 }
 
 type deviceDesc struct {
@@ -161,14 +261,50 @@ type deviceDesc struct {
 		Major int `xml:"major"`
 		Minor int `xml:"minor"`
 	} `xml:"specVersion"`
-	Device struct {
-		Manufacturer string `xml:"manufacturer"`
-		ModelName    string `xml:"modelName"`
-		SerialNumber string `xml:"serialNumber"`
+	URLBase string `xml:"URLBase"`
+	Device  struct {
+		Manufacturer     string        `xml:"manufacturer"`
+		ModelName        string        `xml:"modelName"`
+		ModelNumber      string        `xml:"modelNumber"`
+		ModelDescription string        `xml:"modelDescription"`
+		SerialNumber     string        `xml:"serialNumber"`
+		UDN              string        `xml:"UDN"`
+		DeviceType       string        `xml:"deviceType"`
+		FriendlyName     string        `xml:"friendlyName"`
+		PresentationURL  string        `xml:"presentationURL"`
+		ServiceList      []serviceDesc `xml:"serviceList>service"`
 	} `xml:"device"`
+
+	// location is the URL the description was fetched from, used to resolve
+	// relative control/SCPD URLs when URLBase is not set.
+	location string
 }
 
-func readDeviceDesc(ctx context.Context, url string) (*deviceDesc, error) {
+// baseURL returns the URL that relative service URLs (controlURL, SCPDURL, ...) are
+// resolved against, per the UPnP device architecture spec.
+func (d *deviceDesc) baseURL() string {
+	if d.URLBase != "" {
+		return d.URLBase
+	}
+	return d.location
+}
+
+// ServiceByType returns the service advertised by the device whose serviceType matches urn, if any.
+func (pc *UPNPDevice) ServiceByType(urn string) (*Service, bool) {
+	if pc.Desc == nil {
+		return nil, false
+	}
+
+	for _, sd := range pc.Desc.Device.ServiceList {
+		if sd.ServiceType == urn {
+			return &Service{desc: sd, baseURL: pc.Desc.baseURL()}, true
+		}
+	}
+
+	return nil, false
+}
+
+func fetchURL(ctx context.Context, url string) ([]byte, error) {
 	cli := &http.Client{
 		Timeout: time.Second * 10, //nolint: mnd
 	}
@@ -192,15 +328,29 @@ func readDeviceDesc(ctx context.Context, url string) (*deviceDesc, error) {
 		return nil, fmt.Errorf("can't read body from (%s): %v", url, resp.StatusCode)
 	}
 
+	return data, nil
+}
+
+func readDeviceDesc(ctx context.Context, url string) (*deviceDesc, error) {
+	data, err := fetchURL(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
 	return parseDeviceDesc(url, data)
 }
 
 func parseDeviceDesc(url string, data []byte) (*deviceDesc, error) {
 	var desc deviceDesc
-	err := xml.Unmarshal(data, &desc)
-	if err != nil {
+
+	// devices in the wild declare non-UTF-8 encodings (windows-1252, iso-8859-1, ...), which
+	// xml.Unmarshal rejects outright, so decode through a decoder that can transcode them.
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	if err := decoder.Decode(&desc); err != nil {
 		return nil, fmt.Errorf("bad xml from (%s): %w", url, err)
 	}
+	desc.location = url
 
 	return &desc, nil
 }
@@ -0,0 +1,89 @@
+package viamupnp
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestParseDeviceDescLatin1(t *testing.T) {
+	// encoding="ISO-8859-1" with a manufacturer name containing a byte (0xE9, "é" in
+	// Latin-1) that isn't valid UTF-8 on its own.
+	raw := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<root xmlns=\"urn:schemas-upnp-org:device-1-0\">\n" +
+		"  <device>\n" +
+		"    <manufacturer>Caf\xe9 Devices</manufacturer>\n" +
+		"    <modelName>M1</modelName>\n" +
+		"  </device>\n" +
+		"</root>")
+
+	dd, err := parseDeviceDesc("", raw)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, dd.Device.Manufacturer, test.ShouldEqual, "Café Devices")
+	test.That(t, dd.Device.ModelName, test.ShouldEqual, "M1")
+}
+
+func testDevice() UPNPDevice {
+	dev := UPNPDevice{Desc: &deviceDesc{}}
+	dev.Desc.Device.ModelName = "Axis M1065-L"
+	dev.Desc.Device.Manufacturer = "Axis Communications"
+	dev.Desc.Device.UDN = "uuid:1234-5678"
+	dev.Desc.Device.DeviceType = "urn:schemas-upnp-org:device:NetworkCamera:1"
+	dev.Desc.Device.FriendlyName = "Front Door Camera"
+	return dev
+}
+
+func TestMatchesExact(t *testing.T) {
+	dev := testDevice()
+
+	test.That(t, dev.Matches(DeviceQuery{Manufacturer: "Axis Communications"}), test.ShouldBeTrue)
+	test.That(t, dev.Matches(DeviceQuery{Manufacturer: "Someone Else"}), test.ShouldBeFalse)
+}
+
+func TestMatchesWildcard(t *testing.T) {
+	dev := testDevice()
+
+	test.That(t, dev.Matches(DeviceQuery{ModelName: "Axis M1065-L"}), test.ShouldBeTrue)
+	test.That(t, dev.Matches(DeviceQuery{ModelName: "Axis M*"}), test.ShouldBeFalse)
+	test.That(t, dev.Matches(DeviceQuery{ModelName: "Axis M10.*"}), test.ShouldBeTrue)
+	test.That(t, dev.Matches(DeviceQuery{ModelName: "Axis X.*"}), test.ShouldBeFalse)
+}
+
+func TestMatchesRegex(t *testing.T) {
+	dev := testDevice()
+
+	test.That(t, dev.Matches(DeviceQuery{FriendlyNameRegex: `^Front.*Camera$`}), test.ShouldBeTrue)
+	test.That(t, dev.Matches(DeviceQuery{FriendlyNameRegex: `^Back.*Camera$`}), test.ShouldBeFalse)
+	// an invalid pattern can never match, rather than erroring out of the whole query.
+	test.That(t, dev.Matches(DeviceQuery{FriendlyNameRegex: `(`}), test.ShouldBeFalse)
+}
+
+func TestMatchesExactAndRegexBothRequired(t *testing.T) {
+	dev := testDevice()
+
+	// exact field matches but regex field doesn't: overall query must fail.
+	test.That(t, dev.Matches(DeviceQuery{
+		Manufacturer:    "Axis Communications",
+		DeviceTypeRegex: `Printer`,
+	}), test.ShouldBeFalse)
+
+	// both match: overall query passes.
+	test.That(t, dev.Matches(DeviceQuery{
+		Manufacturer:    "Axis Communications",
+		DeviceTypeRegex: `NetworkCamera`,
+	}), test.ShouldBeTrue)
+}
+
+func TestCompileRegexCached(t *testing.T) {
+	re1, err := compileRegex(`^abc$`)
+	test.That(t, err, test.ShouldBeNil)
+
+	re2, err := compileRegex(`^abc$`)
+	test.That(t, err, test.ShouldBeNil)
+
+	// the cache returns the same compiled *regexp.Regexp for a repeated pattern.
+	test.That(t, re1, test.ShouldEqual, re2)
+
+	_, err = compileRegex(`(`)
+	test.That(t, err, test.ShouldNotBeNil)
+}
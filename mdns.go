@@ -0,0 +1,138 @@
+package viamupnp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edaniels/zeroconf"
+	"github.com/koron/go-ssdp"
+	"go.viam.com/rdk/logging"
+)
+
+// defaultMDNSServiceTypes are the mDNS/DNS-SD service types IP cameras commonly advertise
+// under, for devices that have dropped SSDP or live on networks where multicast SSDP is
+// filtered but mDNS is not.
+var defaultMDNSServiceTypes = []string{"_axis-video._tcp", "_rtsp._tcp", "_onvif._tcp"}
+
+// MDNSDiscoverer finds devices by browsing mDNS/DNS-SD service types instead of SSDP. The
+// network argument to Discover is ignored; mDNS browses on all of the host's interfaces.
+type MDNSDiscoverer struct {
+	Logger logging.Logger
+
+	// ServiceTypes are the DNS-SD service types to browse. Defaults to defaultMDNSServiceTypes.
+	ServiceTypes []string
+
+	// BrowseTimeout bounds how long to wait for responses to each service type browse.
+	// Defaults to 3s.
+	BrowseTimeout time.Duration
+}
+
+// Discover implements Discoverer.
+func (d *MDNSDiscoverer) Discover(ctx context.Context, network string) ([]UPNPDevice, error) {
+	serviceTypes := d.ServiceTypes
+	if len(serviceTypes) == 0 {
+		serviceTypes = defaultMDNSServiceTypes
+	}
+	timeout := d.BrowseTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second //nolint:mnd
+	}
+
+	resolver, err := zeroconf.NewResolver(d.Logger.AsZap())
+	if err != nil {
+		return nil, fmt.Errorf("can't create mdns resolver: %w", err)
+	}
+	defer resolver.Shutdown()
+
+	// Browse every service type concurrently, each against its own timeout: zeroconf only
+	// closes a browse's entries channel when its context is done, so sharing one context (and
+	// thus one deadline) across sequential browses would starve every type after the first of
+	// its fair share of the timeout budget.
+	all := []UPNPDevice{}
+	var allMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, serviceType := range serviceTypes {
+		wg.Add(1)
+		go func(serviceType string) {
+			defer wg.Done()
+
+			browseCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			entries := make(chan *zeroconf.ServiceEntry, 16) //nolint:mnd
+			if err := resolver.Browse(browseCtx, serviceType, "local.", entries); err != nil {
+				d.Logger.Warnf("mdns browse for %s failed: %v", serviceType, err)
+				return
+			}
+
+			for entry := range entries {
+				dev := mdnsEntryToDevice(serviceType, entry)
+				allMu.Lock()
+				all = append(all, dev)
+				allMu.Unlock()
+			}
+		}(serviceType)
+	}
+	wg.Wait()
+
+	return all, nil
+}
+
+// The mdns*Keys lists are the TXT record keys (lowercased) known to carry each deviceDesc field,
+// across the handful of conventions cameras in the wild actually use.
+var (
+	mdnsManufacturerKeys = []string{"manufacturer", "mfg", "vendor"}
+	mdnsModelKeys        = []string{"model", "md", "productname"}
+	mdnsSerialKeys       = []string{"serial", "serialnumber", "sn"}
+)
+
+func mdnsTXTLookup(txt map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v, ok := txt[k]; ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func parseMDNSTXT(records []string) map[string]string {
+	out := map[string]string{}
+	for _, r := range records {
+		key, value, _ := strings.Cut(r, "=")
+		out[strings.ToLower(key)] = value
+	}
+	return out
+}
+
+// mdnsEntryToDevice synthesizes a minimal deviceDesc from an mDNS service entry's TXT
+// records, so the rest of the package (UPNPDevice.Matches, FindHost) can treat mDNS- and
+// SSDP-discovered devices uniformly.
+func mdnsEntryToDevice(serviceType string, entry *zeroconf.ServiceEntry) UPNPDevice {
+	txt := parseMDNSTXT(entry.Text)
+
+	desc := &deviceDesc{}
+	desc.Device.Manufacturer = mdnsTXTLookup(txt, mdnsManufacturerKeys)
+	desc.Device.ModelName = mdnsTXTLookup(txt, mdnsModelKeys)
+	desc.Device.SerialNumber = mdnsTXTLookup(txt, mdnsSerialKeys)
+	desc.Device.FriendlyName = entry.Instance
+	desc.Device.DeviceType = serviceType
+
+	host := entry.HostName
+	if len(entry.AddrIPv4) > 0 {
+		host = entry.AddrIPv4[0].String()
+	}
+	location := fmt.Sprintf("mdns://%s:%d", host, entry.Port)
+	desc.location = location
+
+	return UPNPDevice{
+		Service: ssdp.Service{
+			Type:     serviceType,
+			USN:      fmt.Sprintf("mdns:%s:%s", serviceType, entry.ServiceInstanceName()),
+			Location: location,
+		},
+		Desc: desc,
+	}
+}
@@ -0,0 +1,37 @@
+package viamupnp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/edaniels/zeroconf"
+	"go.viam.com/test"
+)
+
+func TestParseMDNSTXT(t *testing.T) {
+	txt := parseMDNSTXT([]string{"Manufacturer=Axis Communications", "MD=M1065-L", "empty"})
+	test.That(t, txt["manufacturer"], test.ShouldEqual, "Axis Communications")
+	test.That(t, txt["md"], test.ShouldEqual, "M1065-L")
+	test.That(t, txt["empty"], test.ShouldEqual, "")
+}
+
+func TestMDNSTXTLookupFallsBackThroughKeys(t *testing.T) {
+	txt := map[string]string{"vendor": "Axis Communications"}
+	test.That(t, mdnsTXTLookup(txt, mdnsManufacturerKeys), test.ShouldEqual, "Axis Communications")
+	test.That(t, mdnsTXTLookup(txt, mdnsModelKeys), test.ShouldEqual, "")
+}
+
+func TestMDNSEntryToDevice(t *testing.T) {
+	entry := zeroconf.NewServiceEntry("Front Door Camera", "_axis-video._tcp", "local.")
+	entry.Port = 554
+	entry.AddrIPv4 = []net.IP{net.ParseIP("192.168.1.50")}
+	entry.Text = []string{"manufacturer=Axis Communications", "model=M1065-L"}
+
+	dev := mdnsEntryToDevice("_axis-video._tcp", entry)
+
+	test.That(t, dev.Desc.Device.Manufacturer, test.ShouldEqual, "Axis Communications")
+	test.That(t, dev.Desc.Device.ModelName, test.ShouldEqual, "M1065-L")
+	test.That(t, dev.Desc.Device.FriendlyName, test.ShouldEqual, "Front Door Camera")
+	test.That(t, dev.Desc.Device.DeviceType, test.ShouldEqual, "_axis-video._tcp")
+	test.That(t, dev.Service.Location, test.ShouldEqual, "mdns://192.168.1.50:554")
+}
@@ -0,0 +1,354 @@
+package viamupnp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koron/go-ssdp"
+	"go.viam.com/rdk/logging"
+	"golang.org/x/net/ipv4"
+)
+
+// ssdpNotifyAddr is the well-known multicast group and port SSDP NOTIFY advertisements
+// are sent to.
+const ssdpNotifyAddr = "239.255.255.250:1900"
+
+// defaultMaxAge is how long a device is considered live after an advertisement that's
+// missing (or has an unparseable) CACHE-CONTROL max-age.
+const defaultMaxAge = 30 * time.Minute
+
+// EventKind identifies what changed about a device in an Event.
+type EventKind string
+
+const (
+	// Added is emitted the first time a device matching a query is seen.
+	Added EventKind = "added"
+	// Updated is emitted when a device already in the registry re-advertises
+	// (ssdp:alive or ssdp:update).
+	Updated EventKind = "updated"
+	// Removed is emitted when a device sends ssdp:byebye, or its advertisement expires
+	// without a refresh.
+	Removed EventKind = "removed"
+)
+
+// Event is emitted by a Registry when a device's advertised presence changes.
+type Event struct {
+	Kind EventKind
+	USN  string
+	// Device is the matched device. It's nil for Removed events.
+	Device *UPNPDevice
+}
+
+type registryEntry struct {
+	device *UPNPDevice
+	timer  *time.Timer
+
+	// generation increments every time handleAlive (re)schedules this entry's timer.
+	// handleAlive refreshes an entry in place rather than replacing it, so a scheduled
+	// expire callback captures the generation it was scheduled for and expire compares
+	// against the entry's current generation, not its identity, to detect a refresh that
+	// raced the callback.
+	generation int
+}
+
+// stopTimer stops entry's expiry timer and, if that actually prevented it from firing,
+// accounts for the callback goroutine Close would otherwise have waited for.
+func (r *Registry) stopTimer(entry *registryEntry) {
+	if entry.timer.Stop() {
+		r.timerWG.Done()
+	}
+}
+
+// Registry passively listens for SSDP NOTIFY advertisements and maintains a live table of
+// devices matching queries, keyed by USN, emitting Added/Updated/Removed events as devices
+// come and go. Unlike FindHost it never sends M-SEARCH requests, so it can't discover
+// devices that aren't currently re-announcing themselves.
+type Registry struct {
+	logger  logging.Logger
+	queries []DeviceQuery
+
+	mu      sync.Mutex
+	devices map[string]*registryEntry
+
+	events chan Event
+	conn   *ipv4.PacketConn
+	cancel context.CancelFunc
+
+	// wg tracks serve and handleRaw/handleAlive goroutines: the packet-processing work that
+	// can schedule new expiry timers. timerWG tracks only those timers themselves, kept
+	// separate so Close can wait for packet processing to quiesce (after which no further
+	// timers can be scheduled) before it sweeps and stops whatever timers are left, rather
+	// than waiting on a timer's own multi-minute expiry to let a Wait return.
+	wg      sync.WaitGroup
+	timerWG sync.WaitGroup
+}
+
+// NewRegistry starts listening for SSDP advertisements and returns a Registry along with the
+// channel it emits events on. The channel is closed once Close is called. If queries is
+// empty, every advertised device is matched.
+func NewRegistry(ctx context.Context, logger logging.Logger, queries []DeviceQuery) (*Registry, <-chan Event, error) {
+	conn, err := joinNotifyGroup()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &Registry{
+		logger:  logger,
+		queries: queries,
+		devices: map[string]*registryEntry{},
+		events:  make(chan Event, 16), //nolint:mnd
+		conn:    conn,
+		cancel:  cancel,
+	}
+
+	go func() {
+		<-ctx.Done()
+		r.conn.Close()
+	}()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.serve(ctx)
+	}()
+
+	return r, r.events, nil
+}
+
+// Close stops listening for advertisements, waits for in-flight NOTIFYs and expiry
+// callbacks to be handled, and closes the event channel.
+func (r *Registry) Close() {
+	r.cancel()
+
+	// Wait for packet processing to quiesce first: once this returns, handleAlive can no
+	// longer schedule new timers, so the sweep below is guaranteed to see every live one
+	// rather than possibly missing one scheduled moments after the sweep ran.
+	r.wg.Wait()
+
+	r.mu.Lock()
+	for _, entry := range r.devices {
+		r.stopTimer(entry)
+	}
+	r.mu.Unlock()
+
+	// Only expiry callbacks already running (Stop returned false above) remain; they don't
+	// sleep, so this returns promptly rather than waiting on a timer's own expiry.
+	r.timerWG.Wait()
+	close(r.events)
+}
+
+func joinNotifyGroup() (*ipv4.PacketConn, error) {
+	laddr, err := net.ResolveUDPAddr("udp4", ":1900")
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	pconn := ipv4.NewPacketConn(conn)
+
+	ifaces, err := multicastInterfaces()
+	if err != nil {
+		conn.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250)}
+	joined := 0
+	for _, ifi := range ifaces {
+		ifi := ifi
+		if err := pconn.JoinGroup(&ifi, group); err != nil {
+			continue
+		}
+		joined++
+	}
+	if joined == 0 {
+		conn.Close() //nolint:errcheck
+		return nil, fmt.Errorf("no interfaces joined SSDP multicast group %s", ssdpNotifyAddr)
+	}
+
+	return pconn, nil
+}
+
+func (r *Registry) serve(ctx context.Context) {
+	buf := make([]byte, 65535) //nolint:mnd
+	for {
+		n, _, _, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.handleRaw(ctx, data)
+		}()
+	}
+}
+
+var endOfNotifyHeader = []byte("\r\n\r\n")
+
+func (r *Registry) handleRaw(ctx context.Context, data []byte) {
+	// Complement newlines on tail of header for buggy SSDP advertisements.
+	if !bytes.HasSuffix(data, endOfNotifyHeader) {
+		data = append(data, endOfNotifyHeader...)
+	}
+	if !bytes.HasPrefix(data, []byte("NOTIFY")) {
+		return
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		r.logger.Debugf("bad NOTIFY: %v", err)
+		return
+	}
+
+	usn := req.Header.Get("USN")
+	switch nts := req.Header.Get("NTS"); nts {
+	case "ssdp:alive", "ssdp:update":
+		r.handleAlive(ctx, usn, req.Header.Get("LOCATION"), req.Header.Get("CACHE-CONTROL"))
+	case "ssdp:byebye":
+		r.handleByebye(usn)
+	default:
+		r.logger.Debugf("unexpected NTS %q from %s", nts, usn)
+	}
+}
+
+func (r *Registry) handleAlive(ctx context.Context, usn, location, cacheControl string) {
+	if usn == "" || location == "" {
+		return
+	}
+
+	desc, err := readDeviceDesc(ctx, location)
+	if err != nil {
+		r.logger.Debugf("cannot read description for %s (%s): %v", usn, location, err)
+		return
+	}
+
+	dev := &UPNPDevice{Service: ssdp.Service{USN: usn, Location: location}, Desc: desc}
+	if !r.matches(dev) {
+		return
+	}
+
+	maxAge := defaultMaxAge
+	if d, ok := parseMaxAge(cacheControl); ok {
+		maxAge = d
+	}
+
+	r.mu.Lock()
+	entry, existed := r.devices[usn]
+	if existed {
+		r.stopTimer(entry)
+	} else {
+		entry = &registryEntry{}
+		r.devices[usn] = entry
+	}
+	entry.device = dev
+	entry.generation++
+	generation := entry.generation
+	r.timerWG.Add(1)
+	entry.timer = time.AfterFunc(maxAge, func() {
+		defer r.timerWG.Done()
+		r.expire(usn, generation)
+	})
+	r.mu.Unlock()
+
+	kind := Added
+	if existed {
+		kind = Updated
+	}
+	r.emit(Event{Kind: kind, USN: usn, Device: dev})
+}
+
+func (r *Registry) handleByebye(usn string) {
+	if usn == "" {
+		return
+	}
+
+	r.mu.Lock()
+	entry, ok := r.devices[usn]
+	if ok {
+		r.stopTimer(entry)
+		delete(r.devices, usn)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		r.emit(Event{Kind: Removed, USN: usn})
+	}
+}
+
+// expire removes usn's entry once its advertisement goes stale, but only if the entry hasn't
+// been refreshed since this callback was scheduled: handleAlive refreshes an entry in place,
+// so a stopTimer call racing an already-firing callback can't prevent it from running, and
+// without the generation check below it would wrongly delete (and emit Removed for) a device
+// that's actually still alive.
+func (r *Registry) expire(usn string, generation int) {
+	r.mu.Lock()
+	cur, ok := r.devices[usn]
+	if ok && cur.generation == generation {
+		delete(r.devices, usn)
+	} else {
+		ok = false
+	}
+	r.mu.Unlock()
+
+	if ok {
+		r.emit(Event{Kind: Removed, USN: usn})
+	}
+}
+
+// matches reports whether dev satisfies any of the registry's configured queries. A
+// registry with no queries matches every device.
+func (r *Registry) matches(dev *UPNPDevice) bool {
+	if len(r.queries) == 0 {
+		return true
+	}
+
+	for _, q := range r.queries {
+		if dev.Matches(q) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registry) emit(ev Event) {
+	select {
+	case r.events <- ev:
+	default:
+		r.logger.Warnf("registry event channel full, dropping %s event for %s", ev.Kind, ev.USN)
+	}
+}
+
+var maxAgeRx = regexp.MustCompile(`max-age\s*=\s*(\d+)`)
+
+// parseMaxAge extracts the max-age value from a CACHE-CONTROL header value.
+func parseMaxAge(cacheControl string) (time.Duration, bool) {
+	m := maxAgeRx.FindStringSubmatch(cacheControl)
+	if m == nil {
+		return 0, false
+	}
+
+	secs, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
@@ -0,0 +1,100 @@
+package viamupnp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/logging"
+	"go.viam.com/test"
+)
+
+const testDeviceDescXML = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <manufacturer>Test Co</manufacturer>
+    <modelName>T1</modelName>
+  </device>
+</root>`
+
+func deviceDescHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(testDeviceDescXML)) //nolint:errcheck
+}
+
+// newTestRegistry builds a Registry without joining the real SSDP multicast group, so
+// handleAlive/handleByebye/expire/Close can be driven directly in tests.
+func newTestRegistry(t *testing.T, queries []DeviceQuery) *Registry {
+	t.Helper()
+	return &Registry{
+		logger:  logging.NewTestLogger(t),
+		queries: queries,
+		devices: map[string]*registryEntry{},
+		events:  make(chan Event, 16), //nolint:mnd
+		cancel:  func() {},
+	}
+}
+
+func TestRegistryExpireIgnoresStaleEntry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(deviceDescHandler))
+	defer srv.Close()
+
+	r := newTestRegistry(t, nil)
+
+	r.handleAlive(context.Background(), "usn1", srv.URL, "max-age=30")
+
+	r.mu.Lock()
+	staleGeneration := r.devices["usn1"].generation
+	r.mu.Unlock()
+
+	// handleAlive refreshes the entry (and its generation) in place.
+	r.handleAlive(context.Background(), "usn1", srv.URL, "max-age=30")
+
+	// A stale expire callback scheduled before the refresh must not delete the refreshed entry.
+	r.expire("usn1", staleGeneration)
+
+	r.mu.Lock()
+	_, stillPresent := r.devices["usn1"]
+	r.mu.Unlock()
+	test.That(t, stillPresent, test.ShouldBeTrue)
+}
+
+func TestRegistryCloseDoesNotWaitOnPendingTimer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(deviceDescHandler))
+	defer srv.Close()
+
+	r := newTestRegistry(t, nil)
+	r.handleAlive(context.Background(), "usn1", srv.URL, "max-age=3600")
+
+	done := make(chan struct{})
+	go func() {
+		r.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return promptly despite a device with a long-lived expiry timer")
+	}
+}
+
+func TestRegistryByebyeEmitsRemoved(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(deviceDescHandler))
+	defer srv.Close()
+
+	r := newTestRegistry(t, nil)
+	r.handleAlive(context.Background(), "usn1", srv.URL, "max-age=30")
+	<-r.events // Added
+
+	r.handleByebye("usn1")
+	ev := <-r.events
+	test.That(t, ev.Kind, test.ShouldEqual, Removed)
+	test.That(t, ev.USN, test.ShouldEqual, "usn1")
+
+	r.mu.Lock()
+	_, present := r.devices["usn1"]
+	r.mu.Unlock()
+	test.That(t, present, test.ShouldBeFalse)
+}
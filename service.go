@@ -0,0 +1,221 @@
+package viamupnp
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// decodeXML decodes data into v via an xml.Decoder with a charset-aware CharsetReader, so
+// that devices declaring (and using) a non-UTF-8 encoding in SCPD documents and SOAP
+// responses are handled the same way parseDeviceDesc handles them in device descriptions.
+func decodeXML(data []byte, v any) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	return dec.Decode(v)
+}
+
+// Service is a single UPnP service advertised by a device (e.g. AVTransport, RenderingControl)
+// that actions can be invoked on via SOAP.
+type Service struct {
+	desc    serviceDesc
+	baseURL string
+}
+
+// SCPDAction describes a single action an SCPD document says a service supports.
+type SCPDAction struct {
+	Name      string `xml:"name"`
+	Arguments []struct {
+		Name                 string `xml:"name"`
+		Direction            string `xml:"direction"`
+		RelatedStateVariable string `xml:"relatedStateVariable"`
+	} `xml:"argumentList>argument"`
+}
+
+// SCPD is a parsed service control protocol description document, which lists the
+// actions (and their arguments) a service supports.
+type SCPD struct {
+	XMLName xml.Name     `xml:"scpd"`
+	Actions []SCPDAction `xml:"actionList>action"`
+}
+
+// resolveURL resolves ref (which may be relative) against base, as called for by the
+// UPnP device architecture spec for controlURL/SCPDURL/eventSubURL.
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("bad base url (%s): %w", base, err)
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("bad url (%s): %w", ref, err)
+	}
+
+	return b.ResolveReference(r).String(), nil
+}
+
+// FetchSCPD fetches and parses the service's SCPD document, letting callers introspect
+// which actions (and arguments) the service actually supports.
+func (s *Service) FetchSCPD(ctx context.Context) (*SCPD, error) {
+	scpdURL, err := resolveURL(s.baseURL, s.desc.SCPDURL)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fetchURL(ctx, scpdURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var scpd SCPD
+	if err := decodeXML(data, &scpd); err != nil {
+		return nil, fmt.Errorf("bad scpd xml from (%s): %w", scpdURL, err)
+	}
+
+	return &scpd, nil
+}
+
+// buildSOAPEnvelope builds a SOAP 1.1 request envelope invoking action on serviceType with args.
+func buildSOAPEnvelope(serviceType, action string, args map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&buf, `<u:%s xmlns:u=%q>`, action, serviceType)
+	for name, value := range args {
+		fmt.Fprintf(&buf, "<%s>", name)
+		if err := xml.EscapeText(&buf, []byte(value)); err != nil {
+			return nil, fmt.Errorf("can't escape arg %s: %w", name, err)
+		}
+		fmt.Fprintf(&buf, "</%s>", name)
+	}
+	fmt.Fprintf(&buf, `</u:%s>`, action)
+	buf.WriteString(`</s:Body></s:Envelope>`)
+
+	return buf.Bytes(), nil
+}
+
+type soapResponseEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Fault *struct {
+			FaultCode   string `xml:"faultcode"`
+			FaultString string `xml:"faultstring"`
+			Detail      struct {
+				UPnPError struct {
+					ErrorCode        int    `xml:"errorCode"`
+					ErrorDescription string `xml:"errorDescription"`
+				} `xml:"UPnPError"`
+			} `xml:"detail"`
+		} `xml:"Fault"`
+		Inner []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// parseSOAPResponse parses a SOAP response to an action invocation, returning either the
+// action's out-arguments or the UPnPError carried in a SOAP fault.
+func parseSOAPResponse(data []byte) (map[string]string, error) {
+	var env soapResponseEnvelope
+	if err := decodeXML(data, &env); err != nil {
+		return nil, fmt.Errorf("bad soap response: %w", err)
+	}
+
+	if env.Body.Fault != nil {
+		upnpErr := env.Body.Fault.Detail.UPnPError
+		return nil, fmt.Errorf("upnp error %d: %s", upnpErr.ErrorCode, upnpErr.ErrorDescription)
+	}
+
+	return parseArgElements(env.Body.Inner)
+}
+
+// parseArgElements returns the text content of the direct children of the single top-level
+// element in data (the action response element), keyed by element name.
+func parseArgElements(data []byte) (map[string]string, error) {
+	args := map[string]string{}
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	depth := 0
+	var name string
+	var value bytes.Buffer
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("bad xml in soap response body: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				name = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				args[name] = value.String()
+			}
+			depth--
+		}
+	}
+
+	return args, nil
+}
+
+// Invoke calls action on the service with the given input arguments, via a SOAP 1.1 request
+// to the service's control URL, and returns the action's out-arguments.
+func (s *Service) Invoke(ctx context.Context, action string, args map[string]string) (map[string]string, error) {
+	controlURL, err := resolveURL(s.baseURL, s.desc.ControlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := buildSOAPEnvelope(s.desc.ServiceType, action, args)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", fmt.Sprintf("%q", s.desc.ServiceType+"#"+action))
+
+	cli := &http.Client{
+		Timeout: time.Second * 10, //nolint: mnd
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't invoke %s on (%s): %w", action, controlURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read response from (%s): %w", controlURL, err)
+	}
+
+	// a SOAP fault is reported via HTTP 500 with the UPnPError in the body, so don't bail
+	// out on status code alone.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusInternalServerError {
+		return nil, fmt.Errorf("http invoke (%s) not ok: %v", controlURL, resp.StatusCode)
+	}
+
+	return parseSOAPResponse(data)
+}
@@ -0,0 +1,63 @@
+package viamupnp
+
+import (
+	"strings"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestBuildSOAPEnvelope(t *testing.T) {
+	body, err := buildSOAPEnvelope("urn:schemas-upnp-org:service:Foo:1", "Bar", map[string]string{
+		"Baz": "<1 & 2>",
+	})
+	test.That(t, err, test.ShouldBeNil)
+
+	s := string(body)
+	test.That(t, strings.Contains(s, `<u:Bar xmlns:u="urn:schemas-upnp-org:service:Foo:1">`), test.ShouldBeTrue)
+	test.That(t, strings.Contains(s, "<Baz>&lt;1 &amp; 2&gt;</Baz>"), test.ShouldBeTrue)
+	test.That(t, strings.Contains(s, "</u:Bar>"), test.ShouldBeTrue)
+}
+
+func TestParseSOAPResponseSuccess(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:BarResponse xmlns:u="urn:schemas-upnp-org:service:Foo:1">
+      <Baz>hello</Baz>
+    </u:BarResponse>
+  </s:Body>
+</s:Envelope>`)
+
+	args, err := parseSOAPResponse(data)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, args["Baz"], test.ShouldEqual, "hello")
+}
+
+func TestParseSOAPResponseFault(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <s:Fault>
+      <faultcode>s:Client</faultcode>
+      <faultstring>UPnPError</faultstring>
+      <detail>
+        <UPnPError xmlns="urn:schemas-upnp-org:control-1-0">
+          <errorCode>401</errorCode>
+          <errorDescription>Invalid Action</errorDescription>
+        </UPnPError>
+      </detail>
+    </s:Fault>
+  </s:Body>
+</s:Envelope>`)
+
+	_, err := parseSOAPResponse(data)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, strings.Contains(err.Error(), "401"), test.ShouldBeTrue)
+	test.That(t, strings.Contains(err.Error(), "Invalid Action"), test.ShouldBeTrue)
+}
+
+func TestParseArgElementsTruncated(t *testing.T) {
+	_, err := parseArgElements([]byte(`<BarResponse><Baz>hello</Baz`))
+	test.That(t, err, test.ShouldNotBeNil)
+}